@@ -12,6 +12,14 @@ const (
 	// evalBatchDuration is the duration in which evaluations are batched before
 	// commiting to Raft.
 	evalBatchDuration = 200 * time.Millisecond
+
+	// allocHealthBatchDuration is the duration in which alloc health writes
+	// are batched before commiting to Raft.
+	allocHealthBatchDuration = 200 * time.Millisecond
+
+	// statusUpdateBatchDuration is the duration in which deployment status
+	// updates are batched before commiting to Raft.
+	statusUpdateBatchDuration = 200 * time.Millisecond
 )
 
 // EvalBatcher is used to batch the creation of evaluations
@@ -128,3 +136,294 @@ func (f *EvalFuture) Results() (uint64, error) {
 	<-f.waitCh
 	return f.index, f.err
 }
+
+// AllocHealthBatcher batches ApplyDeploymentAllocHealthRequests, coalescing
+// a burst of alloc health writes from many allocations into a single Raft
+// entry. It mirrors EvalBatcher's design.
+type AllocHealthBatcher struct {
+	// raft is used to actually commit the batched requests
+	raft DeploymentRaftEndpoints
+
+	// future to be returned to callers
+	f *AllocHealthFuture
+
+	// inCh is used to pass requests to the daemon process
+	inCh chan *structs.ApplyDeploymentAllocHealthRequest
+
+	// ctx is used to exit the daemon batcher
+	ctx context.Context
+
+	l sync.Mutex
+}
+
+// NewAllocHealthBatcher returns an AllocHealthBatcher that uses the passed
+// raft endpoints to commit the alloc health writes and exits the batcher
+// when the passed context is done.
+func NewAllocHealthBatcher(raft DeploymentRaftEndpoints, ctx context.Context) *AllocHealthBatcher {
+	b := &AllocHealthBatcher{
+		raft: raft,
+		ctx:  ctx,
+		inCh: make(chan *structs.ApplyDeploymentAllocHealthRequest, 10),
+	}
+
+	go b.batcher()
+	return b
+}
+
+// CreateUpdate batches the alloc health write and returns a future that
+// tracks its creation.
+func (b *AllocHealthBatcher) CreateUpdate(req *structs.ApplyDeploymentAllocHealthRequest) *AllocHealthFuture {
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	if b.f == nil {
+		b.f = NewAllocHealthFuture()
+	}
+
+	b.inCh <- req
+	return b.f
+}
+
+// batcher is the long lived batcher goroutine
+func (b *AllocHealthBatcher) batcher() {
+	ticker := time.NewTicker(allocHealthBatchDuration)
+	reqs := make(map[string]*structs.ApplyDeploymentAllocHealthRequest)
+	for {
+		select {
+		case <-b.ctx.Done():
+			ticker.Stop()
+			return
+		case r := <-b.inCh:
+			if existing, ok := reqs[r.DeploymentID]; ok {
+				r = mergeAllocHealthRequests(existing, r)
+			}
+			reqs[r.DeploymentID] = r
+		case <-ticker.C:
+			if len(reqs) == 0 {
+				continue
+			}
+
+			// Capture the future
+			b.l.Lock()
+			f := b.f
+			b.f = nil
+			b.l.Unlock()
+
+			// Shouldn't be possible but protect ourselves
+			if f == nil {
+				continue
+			}
+
+			// Capture the requests
+			all := make([]*structs.ApplyDeploymentAllocHealthRequest, 0, len(reqs))
+			for _, r := range reqs {
+				all = append(all, r)
+			}
+
+			// Upsert the requests
+			f.Set(b.raft.UpsertDeploymentAllocHealthBatch(all))
+
+			// Reset the requests list
+			reqs = make(map[string]*structs.ApplyDeploymentAllocHealthRequest)
+		}
+	}
+}
+
+// mergeAllocHealthRequests unions the healthy and unhealthy alloc IDs of two
+// requests pending for the same deployment. Unlike an evaluation, where any
+// one of a burst of triggers is an interchangeable stand-in for the others,
+// each ApplyDeploymentAllocHealthRequest carries its own caller's alloc IDs;
+// keying pending requests by deployment ID and overwriting on receive would
+// silently drop an earlier caller's alloc IDs whenever two calls land in the
+// same batch window.
+func mergeAllocHealthRequests(existing, incoming *structs.ApplyDeploymentAllocHealthRequest) *structs.ApplyDeploymentAllocHealthRequest {
+	merged := *incoming
+	merged.HealthyAllocationIDs = mergeUniqueIDs(existing.HealthyAllocationIDs, incoming.HealthyAllocationIDs)
+	merged.UnhealthyAllocationIDs = mergeUniqueIDs(existing.UnhealthyAllocationIDs, incoming.UnhealthyAllocationIDs)
+	return &merged
+}
+
+// mergeUniqueIDs returns the union of two ID slices, preserving order and
+// dropping duplicates.
+func mergeUniqueIDs(a, b []string) []string {
+	seen := make(map[string]struct{}, len(a)+len(b))
+	out := make([]string, 0, len(a)+len(b))
+	for _, ids := range [][]string{a, b} {
+		for _, id := range ids {
+			if _, ok := seen[id]; ok {
+				continue
+			}
+			seen[id] = struct{}{}
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// AllocHealthFuture is a future that can be used to retrieve the index the
+// alloc health write was committed at or any error in the process
+type AllocHealthFuture struct {
+	index  uint64
+	err    error
+	waitCh chan struct{}
+}
+
+// NewAllocHealthFuture returns a new AllocHealthFuture
+func NewAllocHealthFuture() *AllocHealthFuture {
+	return &AllocHealthFuture{
+		waitCh: make(chan struct{}),
+	}
+}
+
+// Set sets the results of the future, unblocking any client.
+func (f *AllocHealthFuture) Set(index uint64, err error) {
+	f.index = index
+	f.err = err
+	close(f.waitCh)
+}
+
+// Results returns the creation index and any error.
+func (f *AllocHealthFuture) Results() (uint64, error) {
+	<-f.waitCh
+	return f.index, f.err
+}
+
+// StatusUpdateBatcher batches DeploymentStatusUpdateRequests, coalescing a
+// burst of status updates for the same deployment into a single Raft entry.
+// It mirrors EvalBatcher's design.
+type StatusUpdateBatcher struct {
+	// raft is used to actually commit the batched requests
+	raft DeploymentRaftEndpoints
+
+	// future to be returned to callers
+	f *StatusUpdateFuture
+
+	// inCh is used to pass requests to the daemon process
+	inCh chan *structs.DeploymentStatusUpdateRequest
+
+	// ctx is used to exit the daemon batcher
+	ctx context.Context
+
+	l sync.Mutex
+}
+
+// NewStatusUpdateBatcher returns a StatusUpdateBatcher that uses the passed
+// raft endpoints to commit the status updates and exits the batcher when
+// the passed context is done.
+func NewStatusUpdateBatcher(raft DeploymentRaftEndpoints, ctx context.Context) *StatusUpdateBatcher {
+	b := &StatusUpdateBatcher{
+		raft: raft,
+		ctx:  ctx,
+		inCh: make(chan *structs.DeploymentStatusUpdateRequest, 10),
+	}
+
+	go b.batcher()
+	return b
+}
+
+// CreateUpdate batches the status update and returns a future that tracks
+// its creation.
+func (b *StatusUpdateBatcher) CreateUpdate(req *structs.DeploymentStatusUpdateRequest) *StatusUpdateFuture {
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	if b.f == nil {
+		b.f = NewStatusUpdateFuture()
+	}
+
+	b.inCh <- req
+	return b.f
+}
+
+// batcher is the long lived batcher goroutine
+func (b *StatusUpdateBatcher) batcher() {
+	ticker := time.NewTicker(statusUpdateBatchDuration)
+	reqs := make(map[string]*structs.DeploymentStatusUpdateRequest)
+	for {
+		select {
+		case <-b.ctx.Done():
+			ticker.Stop()
+			return
+		case r := <-b.inCh:
+			id := r.DeploymentUpdate.DeploymentID
+			if existing, ok := reqs[id]; ok && isTerminalDeploymentStatus(existing.DeploymentUpdate.Status) &&
+				!isTerminalDeploymentStatus(r.DeploymentUpdate.Status) {
+				// A terminal status (e.g. failed) already pending for this
+				// deployment in the current window takes precedence over a
+				// stale non-terminal one racing behind it; keying on
+				// deployment ID and overwriting on receive would otherwise
+				// let the later, no-longer-relevant status win.
+				continue
+			}
+			reqs[id] = r
+		case <-ticker.C:
+			if len(reqs) == 0 {
+				continue
+			}
+
+			// Capture the future
+			b.l.Lock()
+			f := b.f
+			b.f = nil
+			b.l.Unlock()
+
+			// Shouldn't be possible but protect ourselves
+			if f == nil {
+				continue
+			}
+
+			// Capture the requests
+			all := make([]*structs.DeploymentStatusUpdateRequest, 0, len(reqs))
+			for _, r := range reqs {
+				all = append(all, r)
+			}
+
+			// Upsert the requests
+			f.Set(b.raft.UpsertDeploymentStatusUpdateBatch(all))
+
+			// Reset the requests list
+			reqs = make(map[string]*structs.DeploymentStatusUpdateRequest)
+		}
+	}
+}
+
+// isTerminalDeploymentStatus reports whether status ends a deployment's
+// lifecycle, so a batched status update carrying it should not be silently
+// discarded in favor of a later, non-terminal update for the same
+// deployment within the same batch window.
+func isTerminalDeploymentStatus(status string) bool {
+	switch status {
+	case structs.DeploymentStatusFailed, structs.DeploymentStatusSuccessful, structs.DeploymentStatusCancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+// StatusUpdateFuture is a future that can be used to retrieve the index the
+// status update was committed at or any error in the process
+type StatusUpdateFuture struct {
+	index  uint64
+	err    error
+	waitCh chan struct{}
+}
+
+// NewStatusUpdateFuture returns a new StatusUpdateFuture
+func NewStatusUpdateFuture() *StatusUpdateFuture {
+	return &StatusUpdateFuture{
+		waitCh: make(chan struct{}),
+	}
+}
+
+// Set sets the results of the future, unblocking any client.
+func (f *StatusUpdateFuture) Set(index uint64, err error) {
+	f.index = index
+	f.err = err
+	close(f.waitCh)
+}
+
+// Results returns the creation index and any error.
+func (f *StatusUpdateFuture) Results() (uint64, error) {
+	<-f.waitCh
+	return f.index, f.err
+}
@@ -0,0 +1,159 @@
+package deploymentwatcher
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+// fakeRaft is a minimal DeploymentRaftEndpoints implementation used to
+// benchmark the cost of committing alloc health writes with and without
+// batching. Every call simulates a fixed Raft apply cost and increments a
+// counter of Raft log entries produced.
+type fakeRaft struct {
+	l       sync.Mutex
+	entries int
+	delay   time.Duration
+}
+
+func (f *fakeRaft) apply() (uint64, error) {
+	time.Sleep(f.delay)
+	f.l.Lock()
+	f.entries++
+	f.l.Unlock()
+	return uint64(f.entries), nil
+}
+
+func (f *fakeRaft) UpsertEvals([]*structs.Evaluation) (uint64, error) { return f.apply() }
+func (f *fakeRaft) UpsertJob(*structs.Job) (uint64, error)            { return f.apply() }
+func (f *fakeRaft) UpsertDeploymentStatusUpdate(*structs.DeploymentStatusUpdateRequest) (uint64, error) {
+	return f.apply()
+}
+func (f *fakeRaft) UpsertDeploymentPromotion(*structs.ApplyDeploymentPromoteRequest) (uint64, error) {
+	return f.apply()
+}
+func (f *fakeRaft) UpsertDeploymentAllocHealth(*structs.ApplyDeploymentAllocHealthRequest) (uint64, error) {
+	return f.apply()
+}
+func (f *fakeRaft) UpsertDeploymentGateEvaluation(*structs.DeploymentGateEvaluation) (uint64, error) {
+	return f.apply()
+}
+func (f *fakeRaft) UpsertJobRevert(*structs.JobRevertRequest) (uint64, error) { return f.apply() }
+func (f *fakeRaft) UpsertDeploymentAllocHealthBatch([]*structs.ApplyDeploymentAllocHealthRequest) (uint64, error) {
+	return f.apply()
+}
+func (f *fakeRaft) UpsertDeploymentStatusUpdateBatch([]*structs.DeploymentStatusUpdateRequest) (uint64, error) {
+	return f.apply()
+}
+
+// BenchmarkAllocHealthUnbatched simulates every concurrent alloc health
+// write committing its own Raft entry, as UpsertDeploymentAllocHealth did
+// before batching.
+func BenchmarkAllocHealthUnbatched(b *testing.B) {
+	raft := &fakeRaft{delay: time.Millisecond}
+
+	b.ResetTimer()
+	var wg sync.WaitGroup
+	for i := 0; i < b.N; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			raft.UpsertDeploymentAllocHealth(&structs.ApplyDeploymentAllocHealthRequest{
+				DeploymentAllocHealthRequest: structs.DeploymentAllocHealthRequest{
+					DeploymentID: fmt.Sprintf("dep-%d", i%16),
+				},
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	b.ReportMetric(float64(raft.entries), "raft_entries")
+}
+
+// BenchmarkAllocHealthBatched simulates the same load coalesced through an
+// AllocHealthBatcher, which should produce far fewer Raft entries during a
+// burst of alloc health transitions.
+func BenchmarkAllocHealthBatched(b *testing.B) {
+	raft := &fakeRaft{delay: time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	batcher := NewAllocHealthBatcher(raft, ctx)
+
+	b.ResetTimer()
+	var wg sync.WaitGroup
+	for i := 0; i < b.N; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			f := batcher.CreateUpdate(&structs.ApplyDeploymentAllocHealthRequest{
+				DeploymentAllocHealthRequest: structs.DeploymentAllocHealthRequest{
+					DeploymentID: fmt.Sprintf("dep-%d", i%16),
+				},
+			})
+			f.Results()
+		}(i)
+	}
+	wg.Wait()
+
+	b.ReportMetric(float64(raft.entries), "raft_entries")
+}
+
+// capturingRaft records every batch it is asked to commit so a test can
+// assert on the merged payload rather than just the resulting index.
+type capturingRaft struct {
+	fakeRaft
+	l       sync.Mutex
+	batches [][]*structs.ApplyDeploymentAllocHealthRequest
+}
+
+func (r *capturingRaft) UpsertDeploymentAllocHealthBatch(reqs []*structs.ApplyDeploymentAllocHealthRequest) (uint64, error) {
+	r.l.Lock()
+	r.batches = append(r.batches, reqs)
+	r.l.Unlock()
+	return r.apply()
+}
+
+// TestAllocHealthBatcher_MergesConcurrentRequests verifies that two calls
+// for the same deployment landing in the same batch window are merged
+// rather than one silently overwriting the other's alloc IDs.
+func TestAllocHealthBatcher_MergesConcurrentRequests(t *testing.T) {
+	raft := &capturingRaft{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	batcher := NewAllocHealthBatcher(raft, ctx)
+
+	f1 := batcher.CreateUpdate(&structs.ApplyDeploymentAllocHealthRequest{
+		DeploymentAllocHealthRequest: structs.DeploymentAllocHealthRequest{
+			DeploymentID:         "dep-1",
+			HealthyAllocationIDs: []string{"alloc-1"},
+		},
+	})
+	f2 := batcher.CreateUpdate(&structs.ApplyDeploymentAllocHealthRequest{
+		DeploymentAllocHealthRequest: structs.DeploymentAllocHealthRequest{
+			DeploymentID:         "dep-1",
+			HealthyAllocationIDs: []string{"alloc-2"},
+		},
+	})
+
+	if _, err := f1.Results(); err != nil {
+		t.Fatalf("f1.Results() returned error: %v", err)
+	}
+	if _, err := f2.Results(); err != nil {
+		t.Fatalf("f2.Results() returned error: %v", err)
+	}
+
+	raft.l.Lock()
+	defer raft.l.Unlock()
+	if len(raft.batches) != 1 || len(raft.batches[0]) != 1 {
+		t.Fatalf("expected a single merged request, got %#v", raft.batches)
+	}
+
+	got := raft.batches[0][0].HealthyAllocationIDs
+	if len(got) != 2 {
+		t.Fatalf("expected both alloc IDs to survive the merge, got %v", got)
+	}
+}
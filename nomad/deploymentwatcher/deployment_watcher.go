@@ -0,0 +1,377 @@
+package deploymentwatcher
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+// stateQueryLimiter is satisfied by both the global *rate.Limiter and the
+// per-deployment adaptiveLimiter so deploymentWatcher doesn't need to know
+// which tier of the hierarchical rate limiter it was handed.
+type stateQueryLimiter interface {
+	Wait(ctx context.Context) error
+}
+
+const (
+	// progressCheckInterval is how often a deploymentWatcher wakes to
+	// evaluate alloc health and, if a promotion policy is set, the
+	// promotion gates for each canary task group.
+	progressCheckInterval = 1 * time.Second
+)
+
+// deploymentTriggers are the set of functions a deploymentWatcher calls to
+// apply changes on behalf of the deployment it is watching. Watcher
+// satisfies this interface and batches the underlying Raft calls.
+type deploymentTriggers interface {
+	// createEvaluation is used to create an evaluation
+	createEvaluation(eval *structs.Evaluation) (uint64, error)
+
+	// upsertJob is used to upsert a job
+	upsertJob(job *structs.Job) (uint64, error)
+
+	// upsertDeploymentStatusUpdate is used to upsert a deployment status
+	// update and potentially create an evaluation
+	upsertDeploymentStatusUpdate(u *structs.DeploymentStatusUpdate, eval *structs.Evaluation, job *structs.Job) (uint64, error)
+
+	// upsertDeploymentPromotion is used to promote canaries in a deployment
+	upsertDeploymentPromotion(req *structs.ApplyDeploymentPromoteRequest) (uint64, error)
+
+	// upsertDeploymentAllocHealth is used to set the health of allocations
+	// in a deployment
+	upsertDeploymentAllocHealth(req *structs.ApplyDeploymentAllocHealthRequest) (uint64, error)
+
+	// upsertDeploymentGateEvaluation records the result of a promotion gate
+	// evaluation for audit purposes
+	upsertDeploymentGateEvaluation(eval *structs.DeploymentGateEvaluation) (uint64, error)
+
+	// upsertJobRevert reverts a job to a prior stable version and commits an
+	// evaluation alongside it in a single Raft entry
+	upsertJobRevert(req *structs.JobRevertRequest) (uint64, error)
+
+	// emitEvent delivers a deployment lifecycle event to the registered
+	// EventSinks
+	emitEvent(deploymentID, jobID string, t EventType, detail string)
+
+	// recordActivity bumps the deployment's per-deployment rate limiter so
+	// an active rollout is polled more closely
+	recordActivity(deploymentID string)
+}
+
+// deploymentWatcher is used to watch a single deployment, record the health
+// of its allocations and promote canaries that become eligible for
+// promotion. The scheduler is only triggered by the evaluation committed
+// with an auto-revert.
+type deploymentWatcher struct {
+	// queryLimiter is used to limit the rate of this deployment's blocking
+	// state queries; it is the deployment's own adaptive token bucket, not
+	// the shared global limiter
+	queryLimiter stateQueryLimiter
+
+	// globalLimiter is the shared limiter bounding the aggregate rate of
+	// blocking state queries across every deployment. watch() must wait on
+	// both this and queryLimiter so GlobalQPS is a real ceiling and an
+	// adaptively-bumped deployment (or simply many idle ones) can't drive
+	// total query load above it.
+	globalLimiter stateQueryLimiter
+
+	// deploymentTriggers holds the set of functions that are used to update
+	// the state of the deployment
+	deploymentTriggers
+
+	logger *log.Logger
+
+	// d is the deployment being watched
+	d *structs.Deployment
+
+	// j is the job the deployment is for
+	j *structs.Job
+
+	// state is used to query the state of allocations and evaluations in
+	// order to determine health and progress
+	state DeploymentStateWatchers
+
+	// promotedTaskGroups tracks which canary task groups have already been
+	// promoted, either by an operator or automatically via gates, so
+	// runPromotionGates doesn't re-evaluate or re-promote them
+	promotedTaskGroups map[string]struct{}
+
+	// metricProviders holds the registered MetricProvider plugins, keyed by
+	// name, used to evaluate a PromotionPolicy's external MetricChecks
+	metricProviders map[string]MetricProvider
+
+	// ctx and exitFn are used to cancel the watcher
+	ctx    context.Context
+	exitFn context.CancelFunc
+
+	l sync.RWMutex
+}
+
+// newDeploymentWatcher returns a deployment watcher that is used to watch
+// a single deployment and trigger the scheduler as needed. queryLimiter is
+// the deployment's own adaptive limiter; globalLimiter is the shared limiter
+// bounding the aggregate query rate across every deployment.
+func newDeploymentWatcher(parent context.Context, queryLimiter, globalLimiter stateQueryLimiter,
+	logger *log.Logger, state DeploymentStateWatchers,
+	d *structs.Deployment, j *structs.Job, triggers deploymentTriggers,
+	metricProviders map[string]MetricProvider) *deploymentWatcher {
+
+	ctx, exitFn := context.WithCancel(parent)
+	w := &deploymentWatcher{
+		queryLimiter:       queryLimiter,
+		globalLimiter:      globalLimiter,
+		logger:             logger,
+		d:                  d,
+		j:                  j,
+		state:              state,
+		promotedTaskGroups: make(map[string]struct{}),
+		metricProviders:    metricProviders,
+		deploymentTriggers: triggers,
+		ctx:                ctx,
+		exitFn:             exitFn,
+	}
+
+	go w.watch()
+	return w
+}
+
+// StopWatch stops watching the deployment. This should be called whenever a
+// deployment is completed or no longer being tracked.
+func (w *deploymentWatcher) StopWatch() {
+	w.exitFn()
+}
+
+// watch is the long lived watcher that tracks the allocation health of a
+// deployment and, once a promotion policy is configured, automatically
+// promotes canaries once their gates are satisfied.
+//
+// Every tick performs a blocking state query against the deployment's own
+// allocations, regardless of whether a promotion policy is configured. The
+// query is gated on both the deployment's adaptive queryLimiter and the
+// shared globalLimiter: the adaptive limiter keeps a busy rollout's queries
+// from starving other deployments, while the global limiter caps the
+// aggregate rate across all of them so GlobalQPS remains a real ceiling no
+// matter how many deployments are active or how aggressively their adaptive
+// rates have been bumped.
+func (w *deploymentWatcher) watch() {
+	ticker := time.NewTicker(progressCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.globalLimiter.Wait(w.ctx); err != nil {
+				continue
+			}
+
+			if err := w.queryLimiter.Wait(w.ctx); err != nil {
+				continue
+			}
+
+			if err := w.refreshCanaryState(); err != nil {
+				w.logger.Printf("[ERR] nomad.deployment_watcher: failed refreshing allocation state for deployment %q: %v", w.d.ID, err)
+				continue
+			}
+
+			w.l.RLock()
+			policy := w.j.Update.PromotionPolicy
+			w.l.RUnlock()
+
+			if policy == nil {
+				continue
+			}
+
+			if err := w.runPromotionGates(policy); err != nil {
+				w.logger.Printf("[ERR] nomad.deployment_watcher: failed evaluating promotion gates for deployment %q: %v", w.d.ID, err)
+			}
+		}
+	}
+}
+
+// refreshCanaryState queries the deployment's current allocations and
+// recomputes each task group's PlacedCanaries, HealthyAllocs and
+// LastCanaryHealthy from the result, replacing the counts captured when the
+// watcher was created (or the last refresh). Without this, w.d is a
+// permanently frozen snapshot and the promotion gates it feeds can never
+// observe a canary actually becoming healthy.
+func (w *deploymentWatcher) refreshCanaryState() error {
+	w.l.RLock()
+	args := &structs.DeploymentSpecificRequest{DeploymentID: w.d.ID}
+	w.l.RUnlock()
+
+	var resp structs.AllocListResponse
+	if err := w.state.Allocations(args, &resp); err != nil {
+		return err
+	}
+
+	type canaryCount struct {
+		placed, healthy int
+		lastHealthy     time.Time
+	}
+	counts := make(map[string]*canaryCount)
+
+	for _, alloc := range resp.Allocations {
+		ds := alloc.DeploymentStatus
+		if ds == nil || !ds.Canary {
+			continue
+		}
+
+		c, ok := counts[alloc.TaskGroup]
+		if !ok {
+			c = &canaryCount{}
+			counts[alloc.TaskGroup] = c
+		}
+
+		c.placed++
+		if ds.Healthy != nil && *ds.Healthy {
+			c.healthy++
+			if ds.Timestamp.After(c.lastHealthy) {
+				c.lastHealthy = ds.Timestamp
+			}
+		}
+	}
+
+	w.l.Lock()
+	defer w.l.Unlock()
+	for name, c := range counts {
+		state, ok := w.d.TaskGroups[name]
+		if !ok {
+			continue
+		}
+
+		state.PlacedCanaries = c.placed
+		state.HealthyAllocs = c.healthy
+		if c.lastHealthy.After(state.LastCanaryHealthy) {
+			state.LastCanaryHealthy = c.lastHealthy
+		}
+	}
+
+	return nil
+}
+
+// SetAllocHealth is used to set the health of allocations for a deployment.
+// If there are any unhealthy allocations, the deployment is marked as failed
+// and the auto-revert logic is given a chance to roll back to the last
+// stable version of the job. Otherwise the allocation health is committed;
+// no evaluation is created.
+func (w *deploymentWatcher) SetAllocHealth(req *structs.DeploymentAllocHealthRequest, resp *structs.DeploymentUpdateResponse) error {
+	w.recordActivity(w.d.ID)
+
+	if len(req.UnhealthyAllocationIDs) == 0 {
+		areq := &structs.ApplyDeploymentAllocHealthRequest{DeploymentAllocHealthRequest: *req}
+		index, err := w.upsertDeploymentAllocHealth(areq)
+		if err != nil {
+			return err
+		}
+
+		resp.Index = index
+		w.emitEvent(w.d.ID, w.j.ID, EventAllocHealthChanged, "")
+		return nil
+	}
+
+	return w.fail(fmt.Sprintf("deployment %q failed because an allocation failed to become healthy", w.d.ID), resp)
+}
+
+// PromoteDeployment is used to promote the requested canary task groups of
+// a deployment, or all of them if All is set. A request naming no group and
+// not setting All is rejected. The promotion is committed without creating
+// an evaluation.
+func (w *deploymentWatcher) PromoteDeployment(req *structs.DeploymentPromoteRequest, resp *structs.DeploymentUpdateResponse) error {
+	if !req.All && len(req.Groups) == 0 {
+		return fmt.Errorf("must specify at least one task group to promote")
+	}
+
+	preq := &structs.ApplyDeploymentPromoteRequest{DeploymentPromoteRequest: *req}
+	index, err := w.upsertDeploymentPromotion(preq)
+	if err != nil {
+		return err
+	}
+
+	w.l.Lock()
+	if req.All {
+		for _, tg := range w.j.TaskGroups {
+			w.promotedTaskGroups[tg.Name] = struct{}{}
+		}
+	} else {
+		for _, tg := range req.Groups {
+			w.promotedTaskGroups[tg] = struct{}{}
+		}
+	}
+	w.l.Unlock()
+
+	resp.Index = index
+	w.emitEvent(w.d.ID, w.j.ID, EventDeploymentPromoted, fmt.Sprintf("groups=%v all=%v", req.Groups, req.All))
+	return nil
+}
+
+// PauseDeployment is used to toggle the pause state on a deployment. The
+// status update is committed without an evaluation, whether the deployment
+// is being paused or unpaused.
+func (w *deploymentWatcher) PauseDeployment(req *structs.DeploymentPauseRequest, resp *structs.DeploymentUpdateResponse) error {
+	status, statusDesc := structs.DeploymentStatusPaused, structs.DeploymentStatusDescriptionPaused
+	event := EventDeploymentPaused
+	if !req.Pause {
+		status, statusDesc = structs.DeploymentStatusRunning, structs.DeploymentStatusDescriptionRunning
+		event = EventDeploymentResumed
+	}
+
+	update := &structs.DeploymentStatusUpdate{
+		DeploymentID:      req.DeploymentID,
+		Status:            status,
+		StatusDescription: statusDesc,
+	}
+
+	index, err := w.upsertDeploymentStatusUpdate(update, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	resp.Index = index
+	w.emitEvent(w.d.ID, w.j.ID, event, "")
+	return nil
+}
+
+// fail marks the deployment as failed with the given description. If the
+// job's update strategy has AutoRevert set, the last stable version of the
+// job is committed as a new revision and the version rolled back to is
+// surfaced on resp for API callers.
+func (w *deploymentWatcher) fail(desc string, resp *structs.DeploymentUpdateResponse) error {
+	update := &structs.DeploymentStatusUpdate{
+		DeploymentID:      w.d.ID,
+		Status:            structs.DeploymentStatusFailed,
+		StatusDescription: desc,
+	}
+
+	index, err := w.upsertDeploymentStatusUpdate(update, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Index = index
+	w.emitEvent(w.d.ID, w.j.ID, EventDeploymentFailed, desc)
+
+	w.l.RLock()
+	autoRevert := w.j.Update.AutoRevert
+	w.l.RUnlock()
+	if !autoRevert {
+		return nil
+	}
+
+	revertedVersion, revertIndex, err := w.rollback()
+	if err != nil {
+		w.logger.Printf("[ERR] nomad.deployment_watcher: failed to auto-revert deployment %q: %v", w.d.ID, err)
+		return nil
+	}
+	if revertedVersion != nil {
+		resp.Index = revertIndex
+		resp.RevertedJobVersion = revertedVersion
+		w.emitEvent(w.d.ID, w.j.ID, EventDeploymentRolledBack, fmt.Sprintf("reverted to version %d", *revertedVersion))
+	}
+
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"time"
 
 	"golang.org/x/time/rate"
 
@@ -30,6 +31,23 @@ type DeploymentRaftEndpoints interface {
 	// UpsertDeploymentAllocHealth is used to set the health of allocations in a
 	// deployment
 	UpsertDeploymentAllocHealth(req *structs.ApplyDeploymentAllocHealthRequest) (uint64, error)
+
+	// UpsertDeploymentGateEvaluation is used to record the result of a
+	// promotion gate evaluation for audit purposes
+	UpsertDeploymentGateEvaluation(eval *structs.DeploymentGateEvaluation) (uint64, error)
+
+	// UpsertJobRevert is used to revert a job to a prior stable version and
+	// commit an evaluation alongside it in a single Raft entry
+	UpsertJobRevert(req *structs.JobRevertRequest) (uint64, error)
+
+	// UpsertDeploymentAllocHealthBatch is used to commit a batch of alloc
+	// health writes, coalesced by AllocHealthBatcher, in a single Raft entry
+	UpsertDeploymentAllocHealthBatch(reqs []*structs.ApplyDeploymentAllocHealthRequest) (uint64, error)
+
+	// UpsertDeploymentStatusUpdateBatch is used to commit a batch of
+	// deployment status updates, coalesced by StatusUpdateBatcher, in a
+	// single Raft entry
+	UpsertDeploymentStatusUpdateBatch(reqs []*structs.DeploymentStatusUpdateRequest) (uint64, error)
 }
 
 // DeploymentStateWatchers are the set of functions required to watch objects on
@@ -57,6 +75,10 @@ const (
 	// limitStateQueriesPerSecond is the number of state queries allowed per
 	// second
 	limitStateQueriesPerSecond = 15.0
+
+	// eventQueueSize bounds the number of pending events per deployment so a
+	// slow EventSink can't stall the watcher goroutine that emitted them.
+	eventQueueSize = 64
 )
 
 // Watcher is used to watch deployments and their allocations created
@@ -66,9 +88,18 @@ type Watcher struct {
 	enabled bool
 	logger  *log.Logger
 
-	// queryLimiter is used to limit the rate of blocking queries
+	// queryLimiter is the global limiter bounding the total rate of
+	// blocking state queries across every deployment
 	queryLimiter *rate.Limiter
 
+	// limiterConfig controls both the global limiter above and the
+	// per-deployment adaptive limiters below
+	limiterConfig *RateLimiterConfig
+
+	// deploymentLimiters holds each deployment's adaptive per-deployment
+	// token bucket, keyed by deployment ID
+	deploymentLimiters map[string]*adaptiveLimiter
+
 	// raft contains the set of Raft endpoints that can be used by the
 	// deployments watcher
 	raft DeploymentRaftEndpoints
@@ -83,6 +114,25 @@ type Watcher struct {
 	// evalBatcher is used to batch the creation of evaluations
 	evalBatcher *EvalBatcher
 
+	// allocHealthBatcher is used to batch alloc health writes
+	allocHealthBatcher *AllocHealthBatcher
+
+	// statusUpdateBatcher is used to batch deployment status updates
+	statusUpdateBatcher *StatusUpdateBatcher
+
+	// metricProviders holds the registered MetricProvider plugins, keyed by
+	// name, so PromotionPolicy MetricChecks can be evaluated against
+	// Prometheus, Datadog, or other query-based backends
+	metricProviders map[string]MetricProvider
+
+	// sinks receive a copy of every deployment lifecycle event
+	sinks []EventSink
+
+	// eventQueues holds a bounded, per-deployment event queue drained by its
+	// own goroutine so a slow sink can't stall the watcher goroutine that
+	// emitted the event
+	eventQueues map[string]chan *DeploymentEvent
+
 	// ctx and exitFn are used to cancel the watcher
 	ctx    context.Context
 	exitFn context.CancelFunc
@@ -91,21 +141,50 @@ type Watcher struct {
 }
 
 // NewDeploymentsWatcher returns a deployments watcher that is used to watch
-// deployments and trigger the scheduler as needed.
-func NewDeploymentsWatcher(logger *log.Logger, w DeploymentStateWatchers, raft DeploymentRaftEndpoints) *Watcher {
+// deployments and trigger the scheduler as needed. A nil limiterConfig uses
+// DefaultRateLimiterConfig.
+func NewDeploymentsWatcher(logger *log.Logger, w DeploymentStateWatchers, raft DeploymentRaftEndpoints, limiterConfig *RateLimiterConfig) *Watcher {
+	if limiterConfig == nil {
+		limiterConfig = DefaultRateLimiterConfig()
+	}
+
 	ctx, exitFn := context.WithCancel(context.Background())
 	return &Watcher{
-		queryLimiter:  rate.NewLimiter(limitStateQueriesPerSecond, 100),
-		stateWatchers: w,
-		raft:          raft,
-		watchers:      make(map[string]*deploymentWatcher, 32),
-		evalBatcher:   NewEvalBatcher(raft, ctx),
-		logger:        logger,
-		ctx:           ctx,
-		exitFn:        exitFn,
+		queryLimiter:        rate.NewLimiter(rate.Limit(limiterConfig.GlobalQPS), limiterConfig.GlobalBurst),
+		limiterConfig:       limiterConfig,
+		deploymentLimiters:  make(map[string]*adaptiveLimiter, 32),
+		stateWatchers:       w,
+		raft:                raft,
+		watchers:            make(map[string]*deploymentWatcher, 32),
+		evalBatcher:         NewEvalBatcher(raft, ctx),
+		allocHealthBatcher:  NewAllocHealthBatcher(raft, ctx),
+		statusUpdateBatcher: NewStatusUpdateBatcher(raft, ctx),
+		metricProviders:     make(map[string]MetricProvider),
+		eventQueues:         make(map[string]chan *DeploymentEvent, 32),
+		logger:              logger,
+		ctx:                 ctx,
+		exitFn:              exitFn,
 	}
 }
 
+// RegisterMetricProvider makes a MetricProvider available for use in a
+// PromotionPolicy's MetricChecks. It should be called during server setup,
+// before the watcher is enabled.
+func (w *Watcher) RegisterMetricProvider(p MetricProvider) {
+	w.l.Lock()
+	defer w.l.Unlock()
+	w.metricProviders[p.Name()] = p
+}
+
+// RegisterEventSink adds an EventSink that will receive a copy of every
+// subsequent deployment lifecycle event. It should be called during server
+// setup, before the watcher is enabled.
+func (w *Watcher) RegisterEventSink(s EventSink) {
+	w.l.Lock()
+	defer w.l.Unlock()
+	w.sinks = append(w.sinks, s)
+}
+
 // SetEnabled is used to control if the watcher is enabled. The watcher
 // should only be enabled on the active leader.
 func (w *Watcher) SetEnabled(enabled bool) {
@@ -134,9 +213,17 @@ func (w *Watcher) Flush() {
 	// Kill everything associated with the watcher
 	w.exitFn()
 
+	for _, q := range w.eventQueues {
+		close(q)
+	}
+
 	w.watchers = make(map[string]*deploymentWatcher, 32)
+	w.eventQueues = make(map[string]chan *DeploymentEvent, 32)
+	w.deploymentLimiters = make(map[string]*adaptiveLimiter, 32)
 	w.ctx, w.exitFn = context.WithCancel(context.Background())
 	w.evalBatcher = NewEvalBatcher(w.raft, w.ctx)
+	w.allocHealthBatcher = NewAllocHealthBatcher(w.raft, w.ctx)
+	w.statusUpdateBatcher = NewStatusUpdateBatcher(w.raft, w.ctx)
 }
 
 // watchDeployments is the long lived go-routine that watches for deployments to
@@ -226,8 +313,24 @@ func (w *Watcher) add(d *structs.Deployment) error {
 		return fmt.Errorf("deployment %q references unknown job %q", d.ID, d.JobID)
 	}
 
-	w.watchers[d.ID] = newDeploymentWatcher(w.ctx, w.queryLimiter, w.logger, w.stateWatchers, d, resp.Job, w)
+	queue := make(chan *DeploymentEvent, eventQueueSize)
+	w.eventQueues[d.ID] = queue
+	go w.drainEvents(queue)
+
+	limiter := newAdaptiveLimiter(w.limiterConfig)
+	w.deploymentLimiters[d.ID] = limiter
+
+	w.watchers[d.ID] = newDeploymentWatcher(w.ctx, limiter, w.queryLimiter, w.logger, w.stateWatchers, d, resp.Job, w, w.metricProviders)
 	w.logger.Printf("[TRACE] nomad.deployments_watcher: tracking deployment %q", d.ID)
+
+	// Enqueue directly on the queue we just created rather than going
+	// through emitEvent, which would try to re-acquire w.l.
+	queue <- &DeploymentEvent{
+		DeploymentID: d.ID,
+		JobID:        resp.Job.ID,
+		Type:         EventDeploymentTracked,
+		Timestamp:    time.Now(),
+	}
 	return nil
 }
 
@@ -247,23 +350,48 @@ func (w *Watcher) remove(d *structs.Deployment) {
 		delete(w.watchers, d.ID)
 		w.logger.Printf("[TRACE] nomad.deployments_watcher: untracking deployment %q", d.ID)
 	}
+
+	if q, ok := w.eventQueues[d.ID]; ok {
+		// Successful completion is only ever observed here, when the
+		// deployment goes inactive with a successful status; unlike
+		// failure and rollback, nothing in this package drives that
+		// transition itself, so emitEvent is never the source of it.
+		// Enqueue directly rather than going through emitEvent, which
+		// would try to re-acquire w.l.
+		if d.Status == structs.DeploymentStatusSuccessful {
+			select {
+			case q <- &DeploymentEvent{
+				DeploymentID: d.ID,
+				JobID:        d.JobID,
+				Type:         EventDeploymentSucceeded,
+				Timestamp:    time.Now(),
+			}:
+			default:
+				w.logger.Printf("[WARN] nomad.deployments_watcher: dropping %q event for deployment %q, sink queue full", EventDeploymentSucceeded, d.ID)
+			}
+		}
+
+		close(q)
+		delete(w.eventQueues, d.ID)
+	}
+
+	delete(w.deploymentLimiters, d.ID)
 }
 
 // SetAllocHealth is used to set the health of allocations for a deployment. If
 // there are any unhealthy allocations, the deployment is updated to be failed.
 // Otherwise the allocations are updated and an evaluation is created.
+//
+// The watcher lookup happens under lock, but the deployment watcher call
+// itself does not, since it triggers batched Raft writes, event emission and
+// rate limiter updates that acquire the same lock.
 func (w *Watcher) SetAllocHealth(req *structs.DeploymentAllocHealthRequest, resp *structs.DeploymentUpdateResponse) error {
-	w.l.Lock()
-	defer w.l.Unlock()
-
-	// Not enabled so no-op
-	if !w.enabled {
-		return nil
+	watcher, err := w.watcherForDeployment(req.DeploymentID)
+	if err != nil {
+		return err
 	}
-
-	watcher, ok := w.watchers[req.DeploymentID]
-	if !ok {
-		return fmt.Errorf("deployment %q not being watched for updates", req.DeploymentID)
+	if watcher == nil {
+		return nil
 	}
 
 	return watcher.SetAllocHealth(req, resp)
@@ -273,17 +401,12 @@ func (w *Watcher) SetAllocHealth(req *structs.DeploymentAllocHealthRequest, resp
 // deployment is marked as failed. Otherwise the deployment is updated and an
 // evaluation is created.
 func (w *Watcher) PromoteDeployment(req *structs.DeploymentPromoteRequest, resp *structs.DeploymentUpdateResponse) error {
-	w.l.Lock()
-	defer w.l.Unlock()
-
-	// Not enabled so no-op
-	if !w.enabled {
-		return nil
+	watcher, err := w.watcherForDeployment(req.DeploymentID)
+	if err != nil {
+		return err
 	}
-
-	watcher, ok := w.watchers[req.DeploymentID]
-	if !ok {
-		return fmt.Errorf("deployment %q not being watched for updates", req.DeploymentID)
+	if watcher == nil {
+		return nil
 	}
 
 	return watcher.PromoteDeployment(req, resp)
@@ -292,20 +415,34 @@ func (w *Watcher) PromoteDeployment(req *structs.DeploymentPromoteRequest, resp
 // PauseDeployment is used to toggle the pause state on a deployment. If the
 // deployment is being unpaused, an evaluation is created.
 func (w *Watcher) PauseDeployment(req *structs.DeploymentPauseRequest, resp *structs.DeploymentUpdateResponse) error {
-	w.l.Lock()
-	defer w.l.Unlock()
+	watcher, err := w.watcherForDeployment(req.DeploymentID)
+	if err != nil {
+		return err
+	}
+	if watcher == nil {
+		return nil
+	}
+
+	return watcher.PauseDeployment(req, resp)
+}
+
+// watcherForDeployment looks up the deploymentWatcher for the given
+// deployment ID. It returns a nil watcher and nil error when the Watcher is
+// disabled, matching the historical no-op behavior of the API methods above.
+func (w *Watcher) watcherForDeployment(deploymentID string) (*deploymentWatcher, error) {
+	w.l.RLock()
+	defer w.l.RUnlock()
 
-	// Not enabled so no-op
 	if !w.enabled {
-		return nil
+		return nil, nil
 	}
 
-	watcher, ok := w.watchers[req.DeploymentID]
+	watcher, ok := w.watchers[deploymentID]
 	if !ok {
-		return fmt.Errorf("deployment %q not being watched for updates", req.DeploymentID)
+		return nil, fmt.Errorf("deployment %q not being watched for updates", deploymentID)
 	}
 
-	return watcher.PauseDeployment(req, resp)
+	return watcher, nil
 }
 
 // createEvaluation commits the given evaluation to Raft but batches the commit
@@ -323,17 +460,22 @@ func (w *Watcher) upsertJob(job *structs.Job) (uint64, error) {
 	return w.raft.UpsertJob(job)
 }
 
-// upsertDeploymentStatusUpdate commits the given deployment update and optional
-// evaluation to Raft
+// upsertDeploymentStatusUpdate commits the given deployment update and
+// optional evaluation to Raft but batches the commit with other calls via
+// statusUpdateBatcher.
 func (w *Watcher) upsertDeploymentStatusUpdate(
 	u *structs.DeploymentStatusUpdate,
 	e *structs.Evaluation,
 	j *structs.Job) (uint64, error) {
-	return w.raft.UpsertDeploymentStatusUpdate(&structs.DeploymentStatusUpdateRequest{
+	w.l.Lock()
+	f := w.statusUpdateBatcher.CreateUpdate(&structs.DeploymentStatusUpdateRequest{
 		DeploymentUpdate: u,
 		Eval:             e,
 		Job:              j,
 	})
+	w.l.Unlock()
+
+	return f.Results()
 }
 
 // upsertDeploymentPromotion commits the given deployment promotion to Raft
@@ -342,7 +484,90 @@ func (w *Watcher) upsertDeploymentPromotion(req *structs.ApplyDeploymentPromoteR
 }
 
 // upsertDeploymentAllocHealth commits the given allocation health changes to
-// Raft
+// Raft but batches the commit with other calls via allocHealthBatcher.
 func (w *Watcher) upsertDeploymentAllocHealth(req *structs.ApplyDeploymentAllocHealthRequest) (uint64, error) {
-	return w.raft.UpsertDeploymentAllocHealth(req)
+	w.l.Lock()
+	f := w.allocHealthBatcher.CreateUpdate(req)
+	w.l.Unlock()
+
+	return f.Results()
+}
+
+// upsertDeploymentGateEvaluation commits the result of a promotion gate
+// evaluation to Raft for audit purposes
+func (w *Watcher) upsertDeploymentGateEvaluation(eval *structs.DeploymentGateEvaluation) (uint64, error) {
+	return w.raft.UpsertDeploymentGateEvaluation(eval)
+}
+
+// upsertJobRevert commits a revert to a prior stable job version, along with
+// an evaluation, to Raft
+func (w *Watcher) upsertJobRevert(req *structs.JobRevertRequest) (uint64, error) {
+	return w.raft.UpsertJobRevert(req)
+}
+
+// emitEvent enqueues a deployment lifecycle event for asynchronous delivery
+// to the registered sinks. The enqueue is non-blocking; if the deployment's
+// queue is full the event is dropped and logged rather than stalling the
+// caller.
+func (w *Watcher) emitEvent(deploymentID, jobID string, t EventType, detail string) {
+	w.l.RLock()
+	q, ok := w.eventQueues[deploymentID]
+	w.l.RUnlock()
+	if !ok {
+		return
+	}
+
+	event := &DeploymentEvent{
+		DeploymentID: deploymentID,
+		JobID:        jobID,
+		Type:         t,
+		Detail:       detail,
+		Timestamp:    time.Now(),
+	}
+
+	select {
+	case q <- event:
+	default:
+		w.logger.Printf("[WARN] nomad.deployments_watcher: dropping %q event for deployment %q, sink queue full", t, deploymentID)
+	}
+}
+
+// recordActivity bumps the given deployment's adaptive rate limiter so its
+// watcher polls state more closely while it is active.
+func (w *Watcher) recordActivity(deploymentID string) {
+	w.l.RLock()
+	limiter, ok := w.deploymentLimiters[deploymentID]
+	w.l.RUnlock()
+	if ok {
+		limiter.RecordActivity()
+	}
+}
+
+// ThrottledWaits returns the number of times the given deployment's
+// per-deployment limiter has actually throttled a caller, so operators can
+// tune RateLimiterConfig. It returns 0 for an unknown deployment.
+func (w *Watcher) ThrottledWaits(deploymentID string) uint64 {
+	w.l.RLock()
+	limiter, ok := w.deploymentLimiters[deploymentID]
+	w.l.RUnlock()
+	if !ok {
+		return 0
+	}
+
+	return limiter.ThrottledWaits()
+}
+
+// drainEvents is the long lived goroutine that fans a single deployment's
+// event queue out to every registered sink. It exits once the queue is
+// closed by remove or Flush.
+func (w *Watcher) drainEvents(q chan *DeploymentEvent) {
+	for event := range q {
+		w.l.RLock()
+		sinks := w.sinks
+		w.l.RUnlock()
+
+		for _, sink := range sinks {
+			sink.Send(event)
+		}
+	}
 }
@@ -0,0 +1,35 @@
+package deploymentwatcher
+
+import "time"
+
+// EventType identifies the kind of deployment lifecycle transition an
+// EventSink is notified of.
+type EventType string
+
+const (
+	EventDeploymentTracked    EventType = "tracked"
+	EventDeploymentPromoted   EventType = "promoted"
+	EventDeploymentPaused     EventType = "paused"
+	EventDeploymentResumed    EventType = "resumed"
+	EventAllocHealthChanged   EventType = "alloc_health_changed"
+	EventDeploymentFailed     EventType = "failed"
+	EventDeploymentSucceeded  EventType = "succeeded"
+	EventDeploymentRolledBack EventType = "rolled_back"
+)
+
+// DeploymentEvent is emitted on every deployment lifecycle transition and
+// delivered, best-effort, to every registered EventSink.
+type DeploymentEvent struct {
+	DeploymentID string
+	JobID        string
+	Type         EventType
+	Detail       string
+	Timestamp    time.Time
+}
+
+// EventSink receives deployment lifecycle events. Send must not block; a
+// sink that cannot keep up should drop events rather than stall the
+// deploymentwatcher goroutine that emitted them.
+type EventSink interface {
+	Send(event *DeploymentEvent)
+}
@@ -0,0 +1,55 @@
+package deploymentwatcher
+
+import "sync"
+
+// defaultRingBufferSize bounds the number of events a MemoryEventSink
+// retains for HTTP streaming consumers.
+const defaultRingBufferSize = 256
+
+// MemoryEventSink is an in-memory ring buffer EventSink. Its contents are
+// exposed via Events so an HTTP handler can stream recent deployment
+// activity without replaying the full history.
+type MemoryEventSink struct {
+	l      sync.Mutex
+	events []*DeploymentEvent
+	next   int
+	full   bool
+}
+
+// NewMemoryEventSink returns a MemoryEventSink retaining up to size events.
+// A non-positive size falls back to defaultRingBufferSize.
+func NewMemoryEventSink(size int) *MemoryEventSink {
+	if size <= 0 {
+		size = defaultRingBufferSize
+	}
+	return &MemoryEventSink{events: make([]*DeploymentEvent, size)}
+}
+
+// Send implements EventSink.
+func (s *MemoryEventSink) Send(event *DeploymentEvent) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	s.events[s.next] = event
+	s.next = (s.next + 1) % len(s.events)
+	if s.next == 0 {
+		s.full = true
+	}
+}
+
+// Events returns a snapshot of the retained events, oldest first.
+func (s *MemoryEventSink) Events() []*DeploymentEvent {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if !s.full {
+		out := make([]*DeploymentEvent, s.next)
+		copy(out, s.events[:s.next])
+		return out
+	}
+
+	out := make([]*DeploymentEvent, len(s.events))
+	copy(out, s.events[s.next:])
+	copy(out[len(s.events)-s.next:], s.events[:s.next])
+	return out
+}
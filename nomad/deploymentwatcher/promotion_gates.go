@@ -0,0 +1,149 @@
+package deploymentwatcher
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+// MetricProvider is implemented by pluggable metric backends (Prometheus,
+// Datadog, and similar query-based systems) so that a PromotionPolicy's
+// MetricChecks can be evaluated on every watcher tick without this package
+// knowing how to talk to any particular backend.
+type MetricProvider interface {
+	// Name identifies the provider so a structs.MetricCheck can reference
+	// it by name.
+	Name() string
+
+	// Query evaluates the given provider-specific query (e.g. a PromQL
+	// expression) and returns its scalar result.
+	Query(ctx context.Context, query string) (float64, error)
+}
+
+// runPromotionGates evaluates, for every canary task group in the
+// deployment that hasn't already been promoted, whether it satisfies the
+// job's PromotionPolicy. Groups whose gates all pass are promoted
+// automatically; groups whose gates are conclusively failed are routed
+// through the same failure path used for unhealthy allocations.
+func (w *deploymentWatcher) runPromotionGates(policy *structs.PromotionPolicy) error {
+	w.l.RLock()
+	groups := w.d.TaskGroups
+	w.l.RUnlock()
+
+	for name, state := range groups {
+		if state.DesiredCanaries == 0 {
+			continue
+		}
+
+		w.l.RLock()
+		_, promoted := w.promotedTaskGroups[name]
+		w.l.RUnlock()
+		if promoted {
+			continue
+		}
+
+		ok, failed, err := w.evaluateGates(name, state, policy)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case ok:
+			if err := w.PromoteDeployment(&structs.DeploymentPromoteRequest{
+				DeploymentID: w.d.ID,
+				Groups:       []string{name},
+			}, &structs.DeploymentUpdateResponse{}); err != nil {
+				return err
+			}
+		case failed:
+			if err := w.fail(fmt.Sprintf(
+				"deployment %q failed because task group %q did not satisfy its promotion policy", w.d.ID, name),
+				&structs.DeploymentUpdateResponse{}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// evaluateGates checks the age, success ratio and external metric gates for
+// a single canary task group. ok reports whether every gate passed; failed
+// reports whether a gate has conclusively failed (as opposed to merely not
+// yet having enough data to decide).
+func (w *deploymentWatcher) evaluateGates(group string, state *structs.DeploymentState, policy *structs.PromotionPolicy) (ok, failed bool, err error) {
+	if state.PlacedCanaries < state.DesiredCanaries {
+		// Not all canaries have been placed yet; nothing to gate on.
+		return false, false, nil
+	}
+
+	healthy := state.HealthyAllocs
+	ratio := float64(healthy) / float64(state.DesiredCanaries)
+	if ratio < policy.RequiredSuccessRatio {
+		return false, false, nil
+	}
+
+	if time.Since(state.LastCanaryHealthy) < policy.MinCanaryAge {
+		return false, false, nil
+	}
+
+	for _, check := range policy.MetricChecks {
+		result, evalErr := w.evaluateMetricCheck(check)
+		if evalErr != nil {
+			w.logger.Printf("[ERR] nomad.deployment_watcher: metric check %q/%q failed for deployment %q: %v",
+				check.Provider, check.Query, w.d.ID, evalErr)
+			return false, false, nil
+		}
+
+		passed := compareMetric(result, check.Threshold, check.Comparison)
+
+		if _, err := w.upsertDeploymentGateEvaluation(&structs.DeploymentGateEvaluation{
+			DeploymentID: w.d.ID,
+			TaskGroup:    group,
+			Provider:     check.Provider,
+			Query:        check.Query,
+			Result:       result,
+			Passed:       passed,
+			Timestamp:    time.Now(),
+		}); err != nil {
+			return false, false, err
+		}
+
+		if !passed {
+			return false, true, nil
+		}
+	}
+
+	return true, false, nil
+}
+
+// evaluateMetricCheck queries the MetricProvider registered for the check.
+func (w *deploymentWatcher) evaluateMetricCheck(check *structs.MetricCheck) (float64, error) {
+	provider, ok := w.metricProviders[check.Provider]
+	if !ok {
+		return 0, fmt.Errorf("no metric provider registered for %q", check.Provider)
+	}
+
+	ctx, cancel := context.WithTimeout(w.ctx, 5*time.Second)
+	defer cancel()
+
+	return provider.Query(ctx, check.Query)
+}
+
+// compareMetric applies the comparison configured on a MetricCheck.
+func compareMetric(result, threshold float64, comparison string) bool {
+	switch comparison {
+	case "gt":
+		return result > threshold
+	case "gte":
+		return result >= threshold
+	case "lt":
+		return result < threshold
+	case "lte":
+		return result <= threshold
+	default:
+		return false
+	}
+}
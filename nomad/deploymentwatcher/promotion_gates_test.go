@@ -0,0 +1,173 @@
+package deploymentwatcher
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+// fakeTriggers is a deploymentTriggers implementation whose methods are
+// no-ops except where a test needs to observe or control their result.
+type fakeTriggers struct {
+	gateEvals []*structs.DeploymentGateEvaluation
+
+	revertReqs  []*structs.JobRevertRequest
+	revertIndex uint64
+	revertErr   error
+}
+
+func (f *fakeTriggers) createEvaluation(*structs.Evaluation) (uint64, error) { return 0, nil }
+func (f *fakeTriggers) upsertJob(*structs.Job) (uint64, error)               { return 0, nil }
+func (f *fakeTriggers) upsertDeploymentStatusUpdate(*structs.DeploymentStatusUpdate, *structs.Evaluation, *structs.Job) (uint64, error) {
+	return 0, nil
+}
+func (f *fakeTriggers) upsertDeploymentPromotion(*structs.ApplyDeploymentPromoteRequest) (uint64, error) {
+	return 0, nil
+}
+func (f *fakeTriggers) upsertDeploymentAllocHealth(*structs.ApplyDeploymentAllocHealthRequest) (uint64, error) {
+	return 0, nil
+}
+func (f *fakeTriggers) upsertDeploymentGateEvaluation(eval *structs.DeploymentGateEvaluation) (uint64, error) {
+	f.gateEvals = append(f.gateEvals, eval)
+	return 1, nil
+}
+func (f *fakeTriggers) upsertJobRevert(req *structs.JobRevertRequest) (uint64, error) {
+	f.revertReqs = append(f.revertReqs, req)
+	return f.revertIndex, f.revertErr
+}
+func (f *fakeTriggers) emitEvent(string, string, EventType, string) {}
+func (f *fakeTriggers) recordActivity(string)                       {}
+
+// fakeMetricProvider is a MetricProvider stub that returns a fixed result or
+// error, regardless of the query it's asked to evaluate.
+type fakeMetricProvider struct {
+	name   string
+	result float64
+	err    error
+}
+
+func (p *fakeMetricProvider) Name() string { return p.name }
+func (p *fakeMetricProvider) Query(context.Context, string) (float64, error) {
+	return p.result, p.err
+}
+
+func testDeploymentWatcher(triggers deploymentTriggers, providers map[string]MetricProvider) *deploymentWatcher {
+	return &deploymentWatcher{
+		logger:             log.New(io.Discard, "", 0),
+		d:                  &structs.Deployment{ID: "dep-1"},
+		metricProviders:    providers,
+		deploymentTriggers: triggers,
+		ctx:                context.Background(),
+	}
+}
+
+func TestEvaluateGates(t *testing.T) {
+	cases := []struct {
+		name       string
+		state      *structs.DeploymentState
+		policy     *structs.PromotionPolicy
+		providers  map[string]MetricProvider
+		wantOK     bool
+		wantFailed bool
+		wantErr    bool
+	}{
+		{
+			name:   "not all canaries placed",
+			state:  &structs.DeploymentState{DesiredCanaries: 3, PlacedCanaries: 2, HealthyAllocs: 2},
+			policy: &structs.PromotionPolicy{RequiredSuccessRatio: 1.0},
+		},
+		{
+			name:   "success ratio too low",
+			state:  &structs.DeploymentState{DesiredCanaries: 2, PlacedCanaries: 2, HealthyAllocs: 1},
+			policy: &structs.PromotionPolicy{RequiredSuccessRatio: 1.0},
+		},
+		{
+			name: "canaries not yet old enough",
+			state: &structs.DeploymentState{
+				DesiredCanaries:   2,
+				PlacedCanaries:    2,
+				HealthyAllocs:     2,
+				LastCanaryHealthy: time.Now(),
+			},
+			policy: &structs.PromotionPolicy{RequiredSuccessRatio: 1.0, MinCanaryAge: time.Hour},
+		},
+		{
+			name: "metric check passes",
+			state: &structs.DeploymentState{
+				DesiredCanaries:   1,
+				PlacedCanaries:    1,
+				HealthyAllocs:     1,
+				LastCanaryHealthy: time.Now().Add(-time.Hour),
+			},
+			policy: &structs.PromotionPolicy{
+				RequiredSuccessRatio: 1.0,
+				MetricChecks: []*structs.MetricCheck{
+					{Provider: "prom", Query: "error_rate", Threshold: 0.5, Comparison: "lt"},
+				},
+			},
+			providers: map[string]MetricProvider{
+				"prom": &fakeMetricProvider{name: "prom", result: 0.1},
+			},
+			wantOK: true,
+		},
+		{
+			name: "metric check conclusively fails",
+			state: &structs.DeploymentState{
+				DesiredCanaries:   1,
+				PlacedCanaries:    1,
+				HealthyAllocs:     1,
+				LastCanaryHealthy: time.Now().Add(-time.Hour),
+			},
+			policy: &structs.PromotionPolicy{
+				RequiredSuccessRatio: 1.0,
+				MetricChecks: []*structs.MetricCheck{
+					{Provider: "prom", Query: "error_rate", Threshold: 0.5, Comparison: "lt"},
+				},
+			},
+			providers: map[string]MetricProvider{
+				"prom": &fakeMetricProvider{name: "prom", result: 0.9},
+			},
+			wantFailed: true,
+		},
+		{
+			name: "metric check errors, not yet conclusive",
+			state: &structs.DeploymentState{
+				DesiredCanaries:   1,
+				PlacedCanaries:    1,
+				HealthyAllocs:     1,
+				LastCanaryHealthy: time.Now().Add(-time.Hour),
+			},
+			policy: &structs.PromotionPolicy{
+				RequiredSuccessRatio: 1.0,
+				MetricChecks: []*structs.MetricCheck{
+					{Provider: "prom", Query: "error_rate", Threshold: 0.5, Comparison: "lt"},
+				},
+			},
+			providers: map[string]MetricProvider{
+				"prom": &fakeMetricProvider{name: "prom", err: errors.New("query timed out")},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := testDeploymentWatcher(&fakeTriggers{}, c.providers)
+
+			ok, failed, err := w.evaluateGates("web", c.state, c.policy)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("evaluateGates() error = %v, wantErr %v", err, c.wantErr)
+			}
+			if ok != c.wantOK {
+				t.Fatalf("evaluateGates() ok = %v, want %v", ok, c.wantOK)
+			}
+			if failed != c.wantFailed {
+				t.Fatalf("evaluateGates() failed = %v, want %v", failed, c.wantFailed)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package deploymentwatcher
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimiterConfig controls the hierarchical rate limiting applied to
+// deployment state queries: a single global limiter bounds the total qps
+// across every deployment, while each deployment additionally gets its own
+// token bucket whose rate adapts to how active that deployment currently
+// is, so a burst of activity on one deployment doesn't starve the rest.
+// deploymentWatcher.watch waits on both tiers before every state query, so
+// GlobalQPS remains a real ceiling on aggregate load regardless of how many
+// deployments are active or how far their adaptive rates have climbed.
+type RateLimiterConfig struct {
+	// GlobalQPS and GlobalBurst bound the total rate of blocking state
+	// queries across all deployments.
+	GlobalQPS   float64
+	GlobalBurst int
+
+	// BaseQPS is the steady-state rate of an idle deployment's limiter.
+	BaseQPS float64
+
+	// MinQPS and MaxQPS bound how far a deployment's limiter can decay or
+	// be bumped.
+	MinQPS float64
+	MaxQPS float64
+
+	// ActivityBumpQPS is added to a deployment's rate whenever it records
+	// activity, such as an allocation health change.
+	ActivityBumpQPS float64
+
+	// IdleDecayInterval is how long a deployment's limiter must go without
+	// activity before its rate is stepped back down towards BaseQPS.
+	IdleDecayInterval time.Duration
+}
+
+// DefaultRateLimiterConfig returns the rate limiter configuration used when
+// NewDeploymentsWatcher isn't given one explicitly.
+func DefaultRateLimiterConfig() *RateLimiterConfig {
+	return &RateLimiterConfig{
+		GlobalQPS:         limitStateQueriesPerSecond,
+		GlobalBurst:       100,
+		BaseQPS:           2,
+		MinQPS:            0.5,
+		MaxQPS:            10,
+		ActivityBumpQPS:   2,
+		IdleDecayInterval: 30 * time.Second,
+	}
+}
+
+// adaptiveLimiter is a per-deployment token bucket whose rate is tuned
+// based on recent activity: alloc health changes bump the rate towards
+// MaxQPS so an active rollout is watched more closely, and a period of
+// inactivity decays it back towards BaseQPS.
+type adaptiveLimiter struct {
+	cfg *RateLimiterConfig
+
+	l          sync.Mutex
+	limiter    *rate.Limiter
+	rate       float64
+	lastActive time.Time
+
+	throttled uint64
+}
+
+// newAdaptiveLimiter returns an adaptiveLimiter starting at cfg.BaseQPS.
+func newAdaptiveLimiter(cfg *RateLimiterConfig) *adaptiveLimiter {
+	return &adaptiveLimiter{
+		cfg:        cfg,
+		limiter:    rate.NewLimiter(rate.Limit(cfg.BaseQPS), 1),
+		rate:       cfg.BaseQPS,
+		lastActive: time.Now(),
+	}
+}
+
+// RecordActivity bumps the limiter's rate, capped at MaxQPS, so an active
+// deployment's watcher can poll state more quickly.
+func (a *adaptiveLimiter) RecordActivity() {
+	a.l.Lock()
+	defer a.l.Unlock()
+
+	a.lastActive = time.Now()
+	a.setRateLocked(a.rate + a.cfg.ActivityBumpQPS)
+}
+
+// decayIfIdle steps the limiter's rate back down towards BaseQPS once it
+// has been idle for longer than IdleDecayInterval. It is called lazily from
+// Wait so no background goroutine is needed per deployment.
+func (a *adaptiveLimiter) decayIfIdle() {
+	a.l.Lock()
+	defer a.l.Unlock()
+
+	if time.Since(a.lastActive) < a.cfg.IdleDecayInterval {
+		return
+	}
+
+	a.lastActive = time.Now()
+	if a.rate > a.cfg.BaseQPS {
+		a.setRateLocked(a.rate - a.cfg.ActivityBumpQPS)
+	}
+}
+
+// setRateLocked updates the limiter's rate, clamped to [MinQPS, MaxQPS]. l
+// must be held.
+func (a *adaptiveLimiter) setRateLocked(newRate float64) {
+	if newRate < a.cfg.MinQPS {
+		newRate = a.cfg.MinQPS
+	}
+	if newRate > a.cfg.MaxQPS {
+		newRate = a.cfg.MaxQPS
+	}
+
+	a.rate = newRate
+	a.limiter.SetLimit(rate.Limit(newRate))
+}
+
+// Wait blocks until the per-deployment limiter permits another query,
+// counting the wait if the caller was actually throttled.
+func (a *adaptiveLimiter) Wait(ctx context.Context) error {
+	a.decayIfIdle()
+
+	if a.limiter.Allow() {
+		return nil
+	}
+
+	atomic.AddUint64(&a.throttled, 1)
+	return a.limiter.Wait(ctx)
+}
+
+// ThrottledWaits returns the number of times a caller had to actually wait
+// on this deployment's limiter, exposed so operators can tune the caps.
+func (a *adaptiveLimiter) ThrottledWaits() uint64 {
+	return atomic.LoadUint64(&a.throttled)
+}
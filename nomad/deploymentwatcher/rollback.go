@@ -0,0 +1,60 @@
+package deploymentwatcher
+
+import (
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+// lastStableJob returns the most recent stable version of the deployment's
+// job older than the currently deployed version, or nil if none of its
+// versions are marked stable.
+func (w *deploymentWatcher) lastStableJob() (*structs.Job, error) {
+	args := &structs.JobSpecificRequest{JobID: w.j.ID}
+	var resp structs.JobVersionsResponse
+	if err := w.state.GetJobVersions(args, &resp); err != nil {
+		return nil, err
+	}
+
+	for _, j := range resp.Versions {
+		if j.Stable && j.Version != w.j.Version {
+			return j, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// rollback reverts the deployment's job to the last stable version and
+// commits an evaluation alongside it so scheduling resumes at that version.
+// It returns the version rolled back to, or nil if no stable version was
+// found to revert to.
+func (w *deploymentWatcher) rollback() (*uint64, uint64, error) {
+	stable, err := w.lastStableJob()
+	if err != nil {
+		return nil, 0, err
+	}
+	if stable == nil {
+		return nil, 0, nil
+	}
+
+	eval := &structs.Evaluation{
+		JobID:        w.j.ID,
+		DeploymentID: w.d.ID,
+		Status:       structs.EvalStatusPending,
+		TriggeredBy:  structs.EvalTriggerRollback,
+	}
+
+	req := &structs.JobRevertRequest{
+		JobID:               w.j.ID,
+		JobVersion:          stable.Version,
+		EnforcePriorVersion: &w.j.Version,
+		Eval:                eval,
+	}
+
+	index, err := w.upsertJobRevert(req)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	version := stable.Version
+	return &version, index, nil
+}
@@ -0,0 +1,144 @@
+package deploymentwatcher
+
+import (
+	"testing"
+
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+// fakeStateWatchers is a DeploymentStateWatchers implementation whose
+// methods are no-ops except GetJobVersions, which is driven by the test.
+type fakeStateWatchers struct {
+	versions []*structs.Job
+	err      error
+}
+
+func (f *fakeStateWatchers) Evaluations(*structs.JobSpecificRequest, *structs.JobEvaluationsResponse) error {
+	return nil
+}
+func (f *fakeStateWatchers) Allocations(*structs.DeploymentSpecificRequest, *structs.AllocListResponse) error {
+	return nil
+}
+func (f *fakeStateWatchers) List(*structs.DeploymentListRequest, *structs.DeploymentListResponse) error {
+	return nil
+}
+func (f *fakeStateWatchers) GetJobVersions(args *structs.JobSpecificRequest, reply *structs.JobVersionsResponse) error {
+	if f.err != nil {
+		return f.err
+	}
+	reply.Versions = f.versions
+	return nil
+}
+func (f *fakeStateWatchers) GetJob(*structs.JobSpecificRequest, *structs.SingleJobResponse) error {
+	return nil
+}
+
+func TestLastStableJob(t *testing.T) {
+	cases := []struct {
+		name           string
+		currentVersion uint64
+		versions       []*structs.Job
+		wantVersion    uint64
+		wantNil        bool
+	}{
+		{
+			name:           "no stable version",
+			currentVersion: 3,
+			versions: []*structs.Job{
+				{Version: 3, Stable: false},
+				{Version: 2, Stable: false},
+			},
+			wantNil: true,
+		},
+		{
+			name:           "most recent stable version older than current is returned",
+			currentVersion: 3,
+			versions: []*structs.Job{
+				{Version: 3, Stable: true},
+				{Version: 2, Stable: true},
+				{Version: 1, Stable: true},
+			},
+			wantVersion: 2,
+		},
+		{
+			name:           "current version excluded even if stable",
+			currentVersion: 5,
+			versions: []*structs.Job{
+				{Version: 5, Stable: true},
+			},
+			wantNil: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := testDeploymentWatcher(&fakeTriggers{}, nil)
+			w.j = &structs.Job{ID: "job1", Version: c.currentVersion}
+			w.state = &fakeStateWatchers{versions: c.versions}
+
+			got, err := w.lastStableJob()
+			if err != nil {
+				t.Fatalf("lastStableJob() returned error: %v", err)
+			}
+
+			if c.wantNil {
+				if got != nil {
+					t.Fatalf("lastStableJob() = version %d, want nil", got.Version)
+				}
+				return
+			}
+
+			if got == nil || got.Version != c.wantVersion {
+				t.Fatalf("lastStableJob() = %#v, want version %d", got, c.wantVersion)
+			}
+		})
+	}
+}
+
+func TestRollback(t *testing.T) {
+	t.Run("no stable version to revert to", func(t *testing.T) {
+		triggers := &fakeTriggers{}
+		w := testDeploymentWatcher(triggers, nil)
+		w.j = &structs.Job{ID: "job1", Version: 2}
+		w.state = &fakeStateWatchers{versions: []*structs.Job{{Version: 2, Stable: false}}}
+
+		version, index, err := w.rollback()
+		if err != nil {
+			t.Fatalf("rollback() returned error: %v", err)
+		}
+		if version != nil {
+			t.Fatalf("rollback() version = %d, want nil", *version)
+		}
+		if index != 0 {
+			t.Fatalf("rollback() index = %d, want 0", index)
+		}
+		if len(triggers.revertReqs) != 0 {
+			t.Fatalf("expected no revert request, got %#v", triggers.revertReqs)
+		}
+	})
+
+	t.Run("reverts to the last stable version", func(t *testing.T) {
+		triggers := &fakeTriggers{revertIndex: 42}
+		w := testDeploymentWatcher(triggers, nil)
+		w.j = &structs.Job{ID: "job1", Version: 3}
+		w.d = &structs.Deployment{ID: "dep-1"}
+		w.state = &fakeStateWatchers{versions: []*structs.Job{
+			{Version: 3, Stable: true},
+			{Version: 1, Stable: true},
+		}}
+
+		version, index, err := w.rollback()
+		if err != nil {
+			t.Fatalf("rollback() returned error: %v", err)
+		}
+		if version == nil || *version != 1 {
+			t.Fatalf("rollback() version = %v, want 1", version)
+		}
+		if index != 42 {
+			t.Fatalf("rollback() index = %d, want 42", index)
+		}
+		if len(triggers.revertReqs) != 1 || triggers.revertReqs[0].JobVersion != 1 {
+			t.Fatalf("expected a revert request to version 1, got %#v", triggers.revertReqs)
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package deploymentwatcher
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// Transport is a minimal pub/sub abstraction, satisfied by a NATS client
+// among others, so deployment events can be published without this package
+// depending on any particular message bus implementation.
+type Transport interface {
+	// Publish sends payload under subject.
+	Publish(subject string, payload []byte) error
+}
+
+// TransportEventSink publishes deployment events to a Transport under a
+// subject derived from subjectPrefix and the deployment ID. Delivery happens
+// on its own goroutine per event so Send never blocks the caller.
+type TransportEventSink struct {
+	transport     Transport
+	subjectPrefix string
+	logger        *log.Logger
+}
+
+// NewTransportEventSink returns a TransportEventSink that publishes through t.
+func NewTransportEventSink(t Transport, subjectPrefix string, logger *log.Logger) *TransportEventSink {
+	return &TransportEventSink{transport: t, subjectPrefix: subjectPrefix, logger: logger}
+}
+
+// Send implements EventSink.
+func (s *TransportEventSink) Send(event *DeploymentEvent) {
+	go s.deliver(event)
+}
+
+func (s *TransportEventSink) deliver(event *DeploymentEvent) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		s.logger.Printf("[ERR] nomad.deployment_watcher: failed to marshal event for transport: %v", err)
+		return
+	}
+
+	subject := s.subjectPrefix + "." + event.DeploymentID
+	if err := s.transport.Publish(subject, payload); err != nil {
+		s.logger.Printf("[ERR] nomad.deployment_watcher: failed to publish event to transport on subject %q: %v", subject, err)
+	}
+}
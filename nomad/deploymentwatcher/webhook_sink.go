@@ -0,0 +1,67 @@
+package deploymentwatcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	// webhookMaxRetries bounds the number of delivery attempts for a single
+	// event before it is dropped.
+	webhookMaxRetries = 5
+
+	// webhookBaseBackoff is the initial delay between retries; it doubles
+	// after every failed attempt.
+	webhookBaseBackoff = 250 * time.Millisecond
+)
+
+// WebhookEventSink posts deployment events as JSON to a configured URL,
+// retrying with exponential backoff on failure. Delivery happens on its own
+// goroutine per event so Send never blocks the caller.
+type WebhookEventSink struct {
+	url    string
+	client *http.Client
+	logger *log.Logger
+}
+
+// NewWebhookEventSink returns a WebhookEventSink that POSTs events to url.
+func NewWebhookEventSink(url string, logger *log.Logger) *WebhookEventSink {
+	return &WebhookEventSink{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+		logger: logger,
+	}
+}
+
+// Send implements EventSink.
+func (s *WebhookEventSink) Send(event *DeploymentEvent) {
+	go s.deliver(event)
+}
+
+func (s *WebhookEventSink) deliver(event *DeploymentEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		s.logger.Printf("[ERR] nomad.deployment_watcher: failed to marshal event for webhook: %v", err)
+		return
+	}
+
+	backoff := webhookBaseBackoff
+	for attempt := 0; attempt < webhookMaxRetries; attempt++ {
+		resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < 300 {
+				return
+			}
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	s.logger.Printf("[WARN] nomad.deployment_watcher: giving up delivering event to webhook %q after %d attempts",
+		s.url, webhookMaxRetries)
+}